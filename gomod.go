@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const defaultGoproxy = "https://proxy.golang.org"
+
+var (
+	inputFormat string
+	goproxy     string
+)
+
+func init() {
+	flag.StringVar(&inputFormat, "format", "", `input file format: "modtxt" (vendor/modules.txt, default) or "gomod" (go.mod, walks the full module graph without vendoring)`)
+	flag.StringVar(&goproxy, "goproxy", defaultGoproxy, "module proxy used to fetch go.mod files for transitive dependencies, GOPROXY-style, when -format gomod")
+}
+
+// detectFormat returns the explicit -format value, or infers "gomod" from
+// the input filename, falling back to the vendor/modules.txt format.
+func detectFormat(path string) string {
+	if inputFormat != "" {
+		return inputFormat
+	}
+	if filepath.Base(path) == "go.mod" {
+		return "gomod"
+	}
+	return "modtxt"
+}
+
+// retraction is a module's own declaration (in a later go.mod) that one of
+// its earlier published versions should not be used.
+type retraction struct {
+	low, high string
+}
+
+// parseGoModGraph parses a go.mod file and walks its transitive module
+// graph the way `cmd/go` does: fetch each required module's own go.mod from
+// the module proxy (or the local module cache), apply minimal version
+// selection (highest version requested anywhere in the graph wins), and
+// honor that module's replace/exclude directives.
+func parseGoModGraph(goModPath string) ([]*Package, error) {
+	data, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := modfile.Parse(goModPath, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[module.Version]bool)
+	for _, ex := range mf.Exclude {
+		excluded[ex.Mod] = true
+	}
+
+	replace := make(map[string]module.Version)
+	for _, r := range mf.Replace {
+		if r.New.Version == "" {
+			fmt.Fprintf(os.Stderr, "warning: skipping local filesystem replace of %s => %s\n", r.Old.Path, r.New.Path)
+			continue
+		}
+		replace[r.Old.Path] = r.New
+	}
+
+	// selected tracks, per original (pre-replace) import path, the highest
+	// requested version of that path together with the module.Version it
+	// actually resolves to once replace directives are applied. The two
+	// differ whenever the path is replaced by a fork under a different
+	// path, and ParsePackage needs both: the Go source still imports the
+	// original path (so that's where the vendor tree / GH_SUBDIR entry
+	// must live), but the tuple's Account/Project/Tag must come from the
+	// replacement actually fetched.
+	type resolvedMod struct {
+		origVersion string
+		newPath     string
+		newVersion  string
+	}
+	selected := make(map[string]resolvedMod)
+	visited := make(map[module.Version]bool)
+	retractions := make(map[string][]retraction)
+
+	queue := make([]module.Version, 0, len(mf.Require))
+	for _, req := range mf.Require {
+		queue = append(queue, req.Mod)
+	}
+
+	for len(queue) > 0 {
+		orig := queue[0]
+		queue = queue[1:]
+
+		resolved := orig
+		if rv, ok := replace[orig.Path]; ok {
+			resolved = rv
+		}
+		if excluded[resolved] {
+			fmt.Fprintf(os.Stderr, "warning: %s@%s is excluded, skipping\n", resolved.Path, resolved.Version)
+			continue
+		}
+		if visited[resolved] {
+			continue
+		}
+		visited[resolved] = true
+
+		if cur, ok := selected[orig.Path]; !ok || semver.Compare(orig.Version, cur.origVersion) > 0 {
+			selected[orig.Path] = resolvedMod{origVersion: orig.Version, newPath: resolved.Path, newVersion: resolved.Version}
+		}
+
+		reqs, rets, err := fetchGoModRequires(resolved)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not fetch go.mod for %s@%s: %v\n", resolved.Path, resolved.Version, err)
+			continue
+		}
+		retractions[resolved.Path] = append(retractions[resolved.Path], rets...)
+		queue = append(queue, reqs...)
+	}
+
+	var paths []string
+	for p := range selected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var packages []*Package
+	for _, p := range paths {
+		sel := selected[p]
+		for _, r := range retractions[sel.newPath] {
+			if semver.Compare(sel.newVersion, r.low) >= 0 && semver.Compare(sel.newVersion, r.high) <= 0 {
+				fmt.Fprintf(os.Stderr, "warning: %s@%s is retracted upstream\n", sel.newPath, sel.newVersion)
+				break
+			}
+		}
+
+		spec := fmt.Sprintf("%s %s", p, sel.newVersion)
+		if sel.newPath != p {
+			// Round-trip through ParsePackage's own " => " handling (used
+			// today for vendor/modules.txt replace lines) so a replaced
+			// module keeps its original import path as Package.Name while
+			// taking its Account/Project/Tag from the replacement fork.
+			spec = fmt.Sprintf("%s %s => %s %s", p, sel.origVersion, sel.newPath, sel.newVersion)
+		}
+
+		pkg, err := ParsePackage(spec)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// fetchGoModRequires returns the direct requirements and self-retractions
+// declared by a single module version's go.mod, reading it from the local
+// module download cache first and falling back to goproxy.
+func fetchGoModRequires(mv module.Version) ([]module.Version, []retraction, error) {
+	escPath, err := module.EscapePath(mv.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	escVersion, err := module.EscapeVersion(mv.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, ok := readModCache(escPath, escVersion)
+	if !ok {
+		if offlineMode {
+			return nil, nil, fmt.Errorf("go.mod for %s@%s not in local module cache and network lookups are disabled", mv.Path, mv.Version)
+		}
+
+		url := fmt.Sprintf("%s/%s/@v/%s.mod", goproxy, escPath, escVersion)
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+		}
+		data, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	depMod, err := modfile.ParseLax(mv.Path+"@"+mv.Version+"/go.mod", data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reqs := make([]module.Version, 0, len(depMod.Require))
+	for _, r := range depMod.Require {
+		reqs = append(reqs, r.Mod)
+	}
+
+	rets := make([]retraction, 0, len(depMod.Retract))
+	for _, r := range depMod.Retract {
+		rets = append(rets, retraction{low: r.Low, high: r.High})
+	}
+
+	return reqs, rets, nil
+}
+
+// readModCache looks for a go.mod previously downloaded by `go mod
+// download`, under $GOPATH/pkg/mod/cache/download, so that -offline runs
+// can resolve the graph without a proxy.
+func readModCache(escPath, escVersion string) ([]byte, bool) {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, false
+		}
+		gopath = filepath.Join(home, "go")
+	}
+
+	modPath := filepath.Join(gopath, "pkg", "mod", "cache", "download", escPath, "@v", escVersion+".mod")
+	data, err := ioutil.ReadFile(modPath)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -2,21 +2,56 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// Host identifies which forge a Package was fetched from, and therefore
+// which *_TUPLE variable it must be emitted under.
+type Host int
+
+const (
+	HostGitHub Host = iota
+	HostGitLab
 )
 
+// TupleName returns the ports Makefile variable used to declare fetch
+// tuples for this host. FreeBSD's Uses/gitlab.mk also covers self-hosted
+// GitLab instances, so everything but GitHub itself shares GL_TUPLE.
+func (h Host) TupleName() string {
+	if h == HostGitHub {
+		return "GH_TUPLE"
+	}
+	return "GL_TUPLE"
+}
+
 type Package struct {
-	Name    string // full package name
-	Account string // Github account
-	Project string // Github project
-	Tag     string // tag or commit ID
+	Name      string // full package name
+	Host      Host   // forge the package is hosted on
+	Account   string // account/group/owner on Host
+	Project   string // project/repo on Host
+	Tag       string // tag or commit ID, as printed in GH_TUPLE/GL_TUPLE: a bare commit prefix for pseudo-versions, the full tag otherwise
+	Version   string // the raw go.mod version string Tag was derived from (e.g. "v0.0.0-20181001143604-e0a95dfd547c"), kept for semver comparisons a truncated pseudo-version Tag can't support
+	Site      string // alternate site, set when it differs from Host's default (e.g. salsa.debian.org)
+	Subdir    string // subdirectory within Account/Project holding this module, set for multi-module repos (e.g. "storage" for cloud.google.com/go/storage)
+	Collapsed bool   // true for a synthesized entry standing in for every Package sharing its Account/Project; see GH_SUBDIR/GL_SUBDIR
 }
 
 // v1.0.0
@@ -69,22 +104,47 @@ func ParsePackage(spec string) (*Package, error) {
 
 	// Parse package name
 	if wk, ok := wellKnownPackages[name]; ok {
+		p.Host = wk.Host
 		p.Account = wk.Account
 		p.Project = wk.Project
+		p.Site = wk.Site
+	} else if kh, ok := matchKnownHost(name); ok {
+		nameParts := strings.Split(name, "/")
+		if len(nameParts) < 3 {
+			return nil, fmt.Errorf("unexpected %s package name: %q", kh.label, name)
+		}
+		p.Host = kh.host
+		p.Account = nameParts[1]
+		p.Project = nameParts[2]
+		p.Site = kh.site
+		if len(nameParts) > 3 {
+			// e.g. github.com/Azure/azure-sdk-for-go/sdk/azcore: a module
+			// nested inside a bigger repo, tagged "sdk/azcore/vX.Y.Z".
+			p.Subdir = strings.Join(nameParts[3:], "/")
+		}
 	} else {
 		switch {
-		case strings.HasPrefix(name, "github.com"):
-			nameParts := strings.Split(name, "/")
-			if len(nameParts) < 3 {
-				return nil, fmt.Errorf("unexpected Github package name: %q", name)
-			}
-			p.Account = nameParts[1]
-			p.Project = nameParts[2]
 		case strings.HasPrefix(name, "gopkg.in"):
 			p.Account, p.Project = parseGopkgInPackage(name)
 		case strings.HasPrefix(name, "golang.org"):
 			p.Account, p.Project = parseGolangOrgPackage(name)
 		}
+
+		// Vanity import path (k8s.io/..., honnef.co/go/tools, rsc.io/..., ...):
+		// ask the server the same question `go get` would.
+		if p.Account == "" || p.Project == "" {
+			if host, account, project, site, prefix, err := resolveVanityImport(name); err == nil {
+				p.Host = host
+				p.Account = account
+				p.Project = project
+				p.Site = site
+				if prefix != "" && prefix != name {
+					// e.g. cloud.google.com/go/storage resolves via the
+					// "cloud.google.com/go" go-import prefix, tagged "storage/vX.Y.Z".
+					p.Subdir = strings.TrimPrefix(name, prefix+"/")
+				}
+			}
+		}
 	}
 
 	// Parse version
@@ -98,6 +158,7 @@ func ParsePackage(spec string) (*Package, error) {
 	default:
 		return nil, fmt.Errorf("unexpected version string: %q", version)
 	}
+	p.Version = version
 
 	return p, nil
 }
@@ -117,6 +178,187 @@ func parseGopkgInPackage(name string) (string, string) {
 	return sm[0][1], sm[0][2]
 }
 
+// knownHost describes a forge that modules2tuple recognizes directly from
+// the package name, without needing a wellKnownPackages entry.
+type knownHost struct {
+	prefix string
+	label  string // used in error messages
+	host   Host
+	site   string // non-default site to record on the Package, e.g. a self-hosted GitLab
+}
+
+// knownHosts lists forges whose import paths embed the account/project
+// directly, in the same "host.tld/account/project" shape as github.com.
+// Self-hosted GitLab instances (Debian's salsa, spreadspace, ...) are
+// recorded with their site so Package.String can emit the gitlab.com-default
+// override.
+// Gitea (gitea.com) and Bitbucket (bitbucket.org) are deliberately absent:
+// neither exposes GL_TUPLE's gitlab.com-shaped archive URL
+// (/-/archive/TAG/PROJECT-TAG.tar.gz), so such packages fall through to an
+// unparsed comment for a human to fix up, same as any other unrecognized
+// host.
+var knownHosts = []knownHost{
+	{prefix: "github.com", label: "Github", host: HostGitHub},
+	{prefix: "gitlab.com", label: "GitLab", host: HostGitLab},
+	{prefix: "salsa.debian.org", label: "GitLab", host: HostGitLab, site: "salsa.debian.org"},
+	{prefix: "git.spreadspace.org", label: "GitLab", host: HostGitLab, site: "git.spreadspace.org"},
+}
+
+func matchKnownHost(name string) (knownHost, bool) {
+	for _, kh := range knownHosts {
+		if strings.HasPrefix(name, kh.prefix) {
+			return kh, true
+		}
+	}
+	return knownHost{}, false
+}
+
+// vanityEntry is the cached result of resolving a vanity import path via its
+// "go-import" meta tag.
+type vanityEntry struct {
+	Host    Host
+	Account string
+	Project string
+	Site    string
+	Prefix  string // the go-import prefix that was matched, so callers can derive a Subdir for nested modules
+}
+
+var (
+	vanityCache       map[string]vanityEntry
+	vanityCacheLoaded bool
+)
+
+// loadVanityCache reads the on-disk vanity cache once per run. A missing or
+// corrupt cache is treated as empty rather than as an error.
+func loadVanityCache() map[string]vanityEntry {
+	if vanityCacheLoaded {
+		return vanityCache
+	}
+	vanityCacheLoaded = true
+	vanityCache = make(map[string]vanityEntry)
+
+	if vanityCachePath == "" {
+		return vanityCache
+	}
+	data, err := ioutil.ReadFile(vanityCachePath)
+	if err != nil {
+		return vanityCache
+	}
+	json.Unmarshal(data, &vanityCache)
+	return vanityCache
+}
+
+func saveVanityCache() error {
+	if vanityCachePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(vanityCachePath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vanityCache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(vanityCachePath, data, 0644)
+}
+
+// goImportRx matches a "go-import" HTML meta tag the same way the go tool
+// does: <meta name="go-import" content="prefix vcs repo-root">.
+var goImportRx = regexp.MustCompile(`<meta\s+name=["']go-import["']\s+content=["']([^"']*)["']`)
+
+// resolveVanityImport classifies a package name that prefix matching and
+// wellKnownPackages couldn't resolve, by fetching https://{name}?go-get=1
+// and parsing its go-import meta tag, exactly as `go get` would. Results are
+// cached on disk so that offline re-runs (-offline / -no-network) stay
+// reproducible.
+func resolveVanityImport(name string) (host Host, account string, project string, site string, prefix string, err error) {
+	cache := loadVanityCache()
+	if e, ok := cache[name]; ok {
+		return e.Host, e.Account, e.Project, e.Site, e.Prefix, nil
+	}
+
+	if offlineMode {
+		return 0, "", "", "", "", fmt.Errorf("no cached vanity entry for %q (network lookups disabled)", name)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("https://%s?go-get=1", name))
+	if err != nil {
+		return 0, "", "", "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", "", "", "", err
+	}
+
+	host, account, project, site, prefix, err = parseGoImportMeta(name, string(body))
+	if err != nil {
+		return 0, "", "", "", "", err
+	}
+
+	cache[name] = vanityEntry{Host: host, Account: account, Project: project, Site: site, Prefix: prefix}
+	if err := saveVanityCache(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to update vanity cache %s: %v\n", vanityCachePath, err)
+	}
+
+	return host, account, project, site, prefix, nil
+}
+
+// parseGoImportMeta picks the go-import tag whose prefix best matches name
+// (the same longest-prefix rule the go tool uses for nested module paths)
+// and classifies its repo-root. The matched prefix is also returned, so a
+// name longer than it (e.g. "cloud.google.com/go/storage" vs. the matched
+// "cloud.google.com/go") can be recorded as a Subdir.
+func parseGoImportMeta(name, body string) (host Host, account string, project string, site string, prefix string, err error) {
+	var bestPrefix, bestRepoRoot string
+
+	for _, sm := range goImportRx.FindAllStringSubmatch(body, -1) {
+		fields := strings.Fields(sm[1])
+		if len(fields) != 3 {
+			continue
+		}
+		p, repoRoot := fields[0], fields[2]
+		if p != name && !strings.HasPrefix(name, p+"/") {
+			continue
+		}
+		if len(p) > len(bestPrefix) {
+			bestPrefix, bestRepoRoot = p, repoRoot
+		}
+	}
+
+	if bestRepoRoot == "" {
+		return 0, "", "", "", "", fmt.Errorf("no go-import meta tag for %q", name)
+	}
+
+	host, account, project, site, err = parseRepoRoot(bestRepoRoot)
+	return host, account, project, site, bestPrefix, err
+}
+
+// parseRepoRoot turns a go-import repo-root URL into a Host/account/project,
+// reusing knownHosts when the repo lives on a forge we already recognize.
+// Any other repo-root host is returned as an error rather than guessed at:
+// we only know the GitLab-shaped GL_TUPLE archive-URL convention, which
+// doesn't hold for every self-hosted forge (see commit dropping Gitea and
+// Bitbucket from knownHosts for the same reason), so an unrecognized host
+// falls through to an unparsed comment instead of risking a wrong tuple.
+func parseRepoRoot(repoRoot string) (Host, string, string, string, error) {
+	trimmed := strings.TrimSuffix(repoRoot, ".git")
+	trimmed = strings.TrimPrefix(trimmed, "https://")
+	trimmed = strings.TrimPrefix(trimmed, "http://")
+
+	kh, ok := matchKnownHost(trimmed)
+	if !ok {
+		return 0, "", "", "", fmt.Errorf("unrecognized repo root host: %q", repoRoot)
+	}
+
+	parts := strings.Split(trimmed, "/")
+	if len(parts) < 3 {
+		return 0, "", "", "", fmt.Errorf("unexpected repo root: %q", repoRoot)
+	}
+	return kh.host, parts[1], parts[2], kh.site, nil
+}
+
 // golang.org/x/pkg -> github.com/golang/pkg
 var golangOrgRx = regexp.MustCompile(`\Agolang\.org/x/([0-9A-Za-z][-0-9A-Za-z]+)\z`)
 
@@ -141,7 +383,17 @@ func (p *Package) Group() string {
 }
 
 func (p *Package) String() string {
-	return fmt.Sprintf("%s:%s:%s:%s/%s/%s", p.Account, p.Project, p.Tag, p.Group(), packagePrefix, p.Name)
+	// A collapsed entry stands in for every module sharing its Account/Project;
+	// individual placement is handled by GH_SUBDIR/GL_SUBDIR instead, so the
+	// destination field is just the bare WRKSRC group name.
+	dest := p.Group()
+	if !p.Collapsed {
+		dest = fmt.Sprintf("%s/%s/%s", dest, packagePrefix, p.Name)
+	}
+	if p.Site != "" {
+		return fmt.Sprintf("%s:%s:%s:%s:%s", p.Account, p.Project, p.Tag, dest, p.Site)
+	}
+	return fmt.Sprintf("%s:%s:%s:%s", p.Account, p.Project, p.Tag, dest)
 }
 
 type PackagesByAccountAndProject []*Package
@@ -159,31 +411,59 @@ func (pp PackagesByAccountAndProject) Less(i, j int) bool {
 }
 
 type WellKnown struct {
-	Account string // Github account
-	Project string // Github project
+	Host    Host   // forge the mirror is hosted on, defaults to Github
+	Account string // account/group/owner on Host
+	Project string // project/repo on Host
+	Site    string // alternate site, set when it differs from Host's default
 }
 
-// List of well-known Github mirrors
+// List of well-known mirrors
 var wellKnownPackages = map[string]WellKnown{
-	// Package name                          GH Account, GH Project
-	"cloud.google.com/go":                       {"googleapis", "google-cloud-go"},
-	"contrib.go.opencensus.io/exporter/ocagent": {"census-ecosystem", "opencensus-go-exporter-ocagent"},
-	"docker.io/go-docker":                       {"docker", "go-docker"},
-	"git.apache.org/thrift.git":                 {"apache", "thrift"},
-	"go.opencensus.io":                          {"census-instrumentation", "opencensus-go"},
-	"go.uber.org/atomic":                        {"uber-go", "atomic"},
-	"google.golang.org/api":                     {"googleapis", "google-api-go-client"},
-	"google.golang.org/appengine":               {"golang", "appengine"},
-	"google.golang.org/genproto":                {"google", "go-genproto"},
-	"google.golang.org/grpc":                    {"grpc", "grpc-go"},
-	"gopkg.in/fsnotify.v1":                      {"fsnotify", "fsnotify"},
+	// Package name                          Host, Account, Project
+	"cloud.google.com/go":                       {Account: "googleapis", Project: "google-cloud-go"},
+	"contrib.go.opencensus.io/exporter/ocagent": {Account: "census-ecosystem", Project: "opencensus-go-exporter-ocagent"},
+	"docker.io/go-docker":                       {Account: "docker", Project: "go-docker"},
+	"git.apache.org/thrift.git":                 {Account: "apache", Project: "thrift"},
+	"go.opencensus.io":                          {Account: "census-instrumentation", Project: "opencensus-go"},
+	"go.uber.org/atomic":                        {Account: "uber-go", Project: "atomic"},
+	"google.golang.org/api":                     {Account: "googleapis", Project: "google-api-go-client"},
+	"google.golang.org/appengine":               {Account: "golang", Project: "appengine"},
+	"google.golang.org/genproto":                {Account: "google", Project: "go-genproto"},
+	"google.golang.org/grpc":                    {Account: "grpc", Project: "grpc-go"},
+	"gopkg.in/fsnotify.v1":                      {Account: "fsnotify", Project: "fsnotify"},
 }
 
 var (
-	packagePrefix string
-	flagVersion   bool
+	packagePrefix     string
+	flagVersion       bool
+	offlineMode       bool
+	vanityCachePath   string
+	distinfoPath      string
+	distinfoJobs      int
+	distinfoVerify    bool
+	distfileCachePath string
 )
 
+// defaultVanityCachePath returns ~/.cache/modules2tuple/vanity.json, or ""
+// if the home directory can't be determined (the cache is then disabled).
+func defaultVanityCachePath() string {
+	return defaultCachePath("vanity.json")
+}
+
+// defaultDistfileCachePath returns ~/.cache/modules2tuple/distfiles.json, or
+// "" if the home directory can't be determined (the cache is then disabled).
+func defaultDistfileCachePath() string {
+	return defaultCachePath("distfiles.json")
+}
+
+func defaultCachePath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cache", "modules2tuple", name)
+}
+
 var version = "devel"
 
 func main() {
@@ -201,46 +481,432 @@ func main() {
 		os.Exit(1)
 	}
 
-	file, err := os.Open(args[0])
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
-
 	var parsedPackages []*Package
 	var unparsedPackages []*Package
-	const specPrefix = "# "
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, specPrefix) {
-			pkg, err := ParsePackage(strings.TrimPrefix(line, specPrefix))
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
+
+	if detectFormat(args[0]) == "gomod" {
+		pkgs, err := parseGoModGraph(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, pkg := range pkgs {
 			if pkg.Parsed() {
 				parsedPackages = append(parsedPackages, pkg)
 			} else {
 				unparsedPackages = append(unparsedPackages, pkg)
 			}
 		}
+	} else {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		const specPrefix = "# "
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, specPrefix) {
+				pkg, err := ParsePackage(strings.TrimPrefix(line, specPrefix))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				if pkg.Parsed() {
+					parsedPackages = append(parsedPackages, pkg)
+				} else {
+					unparsedPackages = append(unparsedPackages, pkg)
+				}
+			}
+		}
 	}
 
-	sort.Sort(PackagesByAccountAndProject(parsedPackages))
+	groups := groupPackagesByRepo(parsedPackages)
+
+	var ghPackages, glPackages []*Package
+	var ghSubdirs, glSubdirs []string
+	for _, g := range groups {
+		tp := g.tuplePackage()
+		if tp.Host.TupleName() == "GH_TUPLE" {
+			ghPackages = append(ghPackages, tp)
+			ghSubdirs = append(ghSubdirs, g.subdirLines()...)
+		} else {
+			glPackages = append(glPackages, tp)
+			glSubdirs = append(glSubdirs, g.subdirLines()...)
+		}
+	}
+
+	printTuple("GH_TUPLE", ghPackages)
+	printSubdir("GH_SUBDIR", ghSubdirs)
+	printTuple("GL_TUPLE", glPackages)
+	printSubdir("GL_SUBDIR", glSubdirs)
+
+	for _, p := range unparsedPackages {
+		fmt.Printf("#\t\t%s\n", p)
+	}
+
+	if distinfoPath != "" {
+		var distfilePackages []*Package
+		for _, g := range groups {
+			distfilePackages = append(distfilePackages, g.tuplePackage())
+		}
+		if err := writeDistinfo(distinfoPath, distfilePackages); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func printTuple(varName string, packages []*Package) {
+	if len(packages) == 0 {
+		return
+	}
 
-	fmt.Println("GH_TUPLE=\t\\")
-	for i, p := range parsedPackages {
+	sort.Sort(PackagesByAccountAndProject(packages))
+
+	fmt.Printf("%s=\t\\\n", varName)
+	for i, p := range packages {
 		fmt.Printf("\t\t%s", p)
-		if i < len(parsedPackages)-1 {
+		if i < len(packages)-1 {
 			fmt.Print(" \\")
 		}
 		fmt.Println("")
 	}
-	for _, p := range unparsedPackages {
-		fmt.Printf("#\t\t%s\n", p)
+}
+
+func printSubdir(varName string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Printf("%s=\t\\\n", varName)
+	for i, line := range lines {
+		fmt.Printf("\t\t%s", line)
+		if i < len(lines)-1 {
+			fmt.Print(" \\")
+		}
+		fmt.Println("")
+	}
+}
+
+// packageGroup collects every parsed Package that shares a repo (Host,
+// Account and Project), so multi-module monorepos like
+// cloud.google.com/go/{storage,pubsub,...} clone that repo exactly once.
+type packageGroup struct {
+	members []*Package
+}
+
+// groupPackagesByRepo buckets packages by repo, preserving first-seen order.
+func groupPackagesByRepo(packages []*Package) []*packageGroup {
+	order := make([]string, 0, len(packages))
+	groups := make(map[string]*packageGroup, len(packages))
+
+	for _, p := range packages {
+		key := fmt.Sprintf("%d:%s/%s", p.Host, p.Account, p.Project)
+		g, ok := groups[key]
+		if !ok {
+			g = &packageGroup{}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.members = append(g.members, p)
+	}
+
+	result := make([]*packageGroup, len(order))
+	for i, key := range order {
+		result[i] = groups[key]
+	}
+	return result
+}
+
+// tuplePackage returns the Package to print in GH_TUPLE/GL_TUPLE for this
+// repo. A repo with a single module is printed exactly as parsed; a repo
+// shared by several modules (the subdir/vX.Y.Z tag convention) collapses to
+// one Collapsed entry carrying the highest per-subdir tag, on the
+// assumption that it also contains compatible sources for the repo's other
+// requested modules. Per-module placement then comes from subdirLines.
+func (g *packageGroup) tuplePackage() *Package {
+	if len(g.members) == 1 {
+		return g.members[0]
+	}
+
+	best := g.members[0]
+	for _, m := range g.members[1:] {
+		// Compare the full version, not Tag: a pseudo-version's Tag is
+		// truncated down to a bare commit-hash prefix (no "vX.Y.Z-...-"
+		// around it), which semver.Compare would otherwise treat as
+		// invalid and sort below every real tag regardless of recency.
+		if semver.Compare(m.Version, best.Version) > 0 {
+			best = m
+		}
+	}
+
+	tag := best.Tag
+	if best.Subdir != "" {
+		tag = best.Subdir + "/" + tag
+	}
+
+	return &Package{
+		Host:      best.Host,
+		Account:   best.Account,
+		Project:   best.Project,
+		Site:      best.Site,
+		Tag:       tag,
+		Collapsed: true,
+	}
+}
+
+// subdirLines returns one GH_SUBDIR/GL_SUBDIR entry per module sharing this
+// repo, mapping the module's location inside the collapsed tarball (or "."
+// for the repo's own root module) to where it must land under
+// packagePrefix. Single-module repos need no such mapping.
+func (g *packageGroup) subdirLines() []string {
+	if len(g.members) == 1 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(g.members))
+	for _, m := range g.members {
+		from := m.Subdir
+		if from == "" {
+			from = "."
+		}
+		lines = append(lines, fmt.Sprintf("%s:%s/%s/%s", from, m.Group(), packagePrefix, m.Name))
 	}
+	sort.Strings(lines)
+	return lines
+}
+
+// distfileEntry is the cached checksum of a downloaded distfile.
+type distfileEntry struct {
+	SHA256 string
+	Size   int64
+}
+
+var (
+	distfileCacheMu     sync.Mutex
+	distfileCache       map[string]distfileEntry
+	distfileCacheLoaded bool
+)
+
+// loadDistfileCache returns the on-disk distfile checksum cache, loading it
+// on first use. Callers must hold distfileCacheMu.
+func loadDistfileCache() map[string]distfileEntry {
+	if distfileCacheLoaded {
+		return distfileCache
+	}
+	distfileCacheLoaded = true
+	distfileCache = make(map[string]distfileEntry)
+
+	if distfileCachePath == "" {
+		return distfileCache
+	}
+	data, err := ioutil.ReadFile(distfileCachePath)
+	if err != nil {
+		return distfileCache
+	}
+	json.Unmarshal(data, &distfileCache)
+	return distfileCache
+}
+
+// saveDistfileCache persists the cache to disk. Callers must hold
+// distfileCacheMu.
+func saveDistfileCache() error {
+	if distfileCachePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(distfileCachePath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(distfileCache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(distfileCachePath, data, 0644)
+}
+
+// distfileName returns the distfile name the ports framework derives from a
+// GH_TUPLE/GL_TUPLE entry: "${ACCOUNT}-${PROJECT}-${TAG}_GH0.tar.gz" (or
+// _GL0 for GitLab-hosted packages).
+func distfileName(p *Package) string {
+	suffix := "GH0"
+	if p.Host != HostGitHub {
+		suffix = "GL0"
+	}
+	// Nested-module tags (e.g. "storage/v1.2.5") can't appear verbatim in a
+	// filename.
+	tag := strings.ReplaceAll(p.Tag, "/", "_")
+	return fmt.Sprintf("%s-%s-%s_%s.tar.gz", p.Account, p.Project, tag, suffix)
+}
+
+// distfileURL returns the tarball URL the ports framework fetches for a
+// package's fetch tuple.
+func distfileURL(p *Package) string {
+	if p.Host == HostGitHub {
+		return fmt.Sprintf("https://codeload.github.com/%s/%s/tar.gz/%s", p.Account, p.Project, p.Tag)
+	}
+	site := p.Site
+	if site == "" {
+		site = "gitlab.com"
+	}
+	return fmt.Sprintf("https://%s/%s/%s/-/archive/%s/%s-%s.tar.gz", site, p.Account, p.Project, p.Tag, p.Project, p.Tag)
+}
+
+// hashDistfile downloads (or reuses a cached checksum for) a package's
+// distfile and returns its SHA256 and size, matching `distinfo`'s fields.
+func hashDistfile(p *Package) (sum string, size int64, err error) {
+	key := fmt.Sprintf("%d:%s/%s@%s", p.Host, p.Account, p.Project, p.Tag)
+
+	distfileCacheMu.Lock()
+	cache := loadDistfileCache()
+	if e, ok := cache[key]; ok {
+		distfileCacheMu.Unlock()
+		return e.SHA256, e.Size, nil
+	}
+	distfileCacheMu.Unlock()
+
+	resp, err := http.Get(distfileURL(p))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("fetching %s: %s", distfileURL(p), resp.Status)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	distfileCacheMu.Lock()
+	cache[key] = distfileEntry{SHA256: sum, Size: n}
+	if err := saveDistfileCache(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to update distfile cache %s: %v\n", distfileCachePath, err)
+	}
+	distfileCacheMu.Unlock()
+
+	return sum, n, nil
+}
+
+type distfileResult struct {
+	name string
+	sum  string
+	size int64
+}
+
+// writeDistinfo hashes the distfile for every package (bounded by -j
+// parallel downloads) and writes a ports-style distinfo file, or, in
+// -verify mode, compares the hashes against an existing one and reports
+// drift instead of overwriting it.
+func writeDistinfo(path string, packages []*Package) error {
+	jobs := make(chan *Package)
+	results := make(chan distfileResult)
+	errs := make(chan error, len(packages))
+
+	workers := distinfoJobs
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				sum, size, err := hashDistfile(p)
+				if err != nil {
+					errs <- fmt.Errorf("%s/%s: %w", p.Account, p.Project, err)
+					continue
+				}
+				results <- distfileResult{name: distfileName(p), sum: sum, size: size}
+			}
+		}()
+	}
+
+	go func() {
+		for _, p := range packages {
+			jobs <- p
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+		close(errs)
+	}()
+
+	entries := make(map[string]distfileResult)
+	var names []string
+	for r := range results {
+		entries[r.name] = r
+		names = append(names, r.name)
+	}
+	for err := range errs {
+		fmt.Fprintln(os.Stderr, "skipping distinfo entry:", err)
+	}
+	sort.Strings(names)
+
+	if distinfoVerify {
+		return verifyDistinfo(path, entries, names)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "TIMESTAMP = %d\n", time.Now().Unix())
+	for _, name := range names {
+		r := entries[name]
+		fmt.Fprintf(f, "SHA256 (%s) = %s\n", name, r.sum)
+		fmt.Fprintf(f, "SIZE (%s) = %d\n", name, r.size)
+	}
+	return nil
+}
+
+var distinfoSha256Rx = regexp.MustCompile(`^SHA256 \(([^)]+)\) = ([0-9a-f]+)$`)
+
+// verifyDistinfo compares freshly-hashed distfiles against an existing
+// distinfo file and reports any mismatch or missing entry as drift.
+func verifyDistinfo(path string, entries map[string]distfileResult, names []string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if sm := distinfoSha256Rx.FindStringSubmatch(line); sm != nil {
+			existing[sm[1]] = sm[2]
+		}
+	}
+
+	drift := false
+	for _, name := range names {
+		want, ok := existing[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "drift: %s missing from %s\n", name, path)
+			drift = true
+			continue
+		}
+		if want != entries[name].sum {
+			fmt.Fprintf(os.Stderr, "drift: %s: distinfo has %s, distfile hashes to %s\n", name, want, entries[name].sum)
+			drift = true
+		}
+	}
+	if drift {
+		return fmt.Errorf("distinfo drift detected against %s", path)
+	}
+	return nil
 }
 
 var helpTemplate = template.Must(template.New("help").Parse(`
@@ -251,12 +917,24 @@ Vendor package dependencies and then run {{.Name}} on vendor/modules.txt:
 
 By default, generated GH_TUPLE entries will place packages under "vendor".
 This can be changed by passing different prefix using -prefix option (e.g. -prefix src).
+
+{{.Name}} can also run directly against a go.mod, without vendoring, by
+walking its module graph against a proxy (-goproxy, defaults to proxy.golang.org):
+
+	$ {{.Name}} go.mod
 `))
 
 func init() {
 	basename := path.Base(os.Args[0])
 	flag.StringVar(&packagePrefix, "prefix", "vendor", "package prefix")
 	flag.BoolVar(&flagVersion, "v", false, "show version")
+	flag.BoolVar(&offlineMode, "offline", false, "resolve vanity import paths from the cache only, never over the network")
+	flag.BoolVar(&offlineMode, "no-network", false, "alias for -offline")
+	flag.StringVar(&vanityCachePath, "vanity-cache", defaultVanityCachePath(), "path to the vanity import path resolution cache")
+	flag.StringVar(&distinfoPath, "distinfo", "", "write a FreeBSD ports distinfo file with SHA256/SIZE entries for every parsed package")
+	flag.IntVar(&distinfoJobs, "j", 1, "number of parallel distfile downloads when generating -distinfo")
+	flag.BoolVar(&distinfoVerify, "verify", false, "re-hash distfiles and compare against the existing -distinfo file instead of overwriting it")
+	flag.StringVar(&distfileCachePath, "distfile-cache", defaultDistfileCachePath(), "path to the downloaded-distfile checksum cache")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] modules.txt\n", basename)
 		flag.PrintDefaults()